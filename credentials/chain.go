@@ -0,0 +1,178 @@
+package credentials
+
+import (
+	"os"
+	"strings"
+)
+
+// Entry pairs a Helper with the name it was constructed from and whether
+// Chain may write to it. Chain itself does not read Name.
+type Entry struct {
+	Name     string
+	Helper   Helper
+	ReadOnly bool
+}
+
+// Chain is a Helper composed of an ordered list of helpers. It lets a single
+// docker client fall back from one credentials store to another, e.g. `pass`
+// when initialized with a `secretservice` fallback on Linux, or the macOS
+// login keychain backed by an encrypted file for CI.
+type Chain struct {
+	entries []Entry
+}
+
+// NewChain builds a Chain from the given entries, tried in order.
+func NewChain(entries ...Entry) *Chain {
+	return &Chain{entries: entries}
+}
+
+// NewChainFromEnv builds a Chain from the helpers named in the
+// DOCKER_CREDENTIAL_HELPERS environment variable, a comma-separated list such
+// as "pass,secretservice,file". lookup resolves a helper name (as it would
+// appear in a docker-credential-<name> binary) to a Helper implementation;
+// names lookup does not recognize are skipped.
+func NewChainFromEnv(lookup func(name string) (Helper, bool)) *Chain {
+	return chainFromNames(os.Getenv("DOCKER_CREDENTIAL_HELPERS"), lookup)
+}
+
+// defaultStoreNames is the fallback order DetectDefaultStore uses when
+// DOCKER_CREDENTIAL_HELPERS isn't set: prefer pass, since it's the most
+// common Linux setup, and fall back to secretservice.
+const defaultStoreNames = "pass,secretservice"
+
+// DetectDefaultStore returns the Helper docker should use when no store is
+// configured explicitly. It honors DOCKER_CREDENTIAL_HELPERS exactly like
+// NewChainFromEnv when set, and otherwise falls back to defaultStoreNames.
+// Unlike the name-based detection this replaces, callers get back a ready to
+// use Helper rather than having to special-case a single store name: pass
+// and secretservice are tried in order instead of being treated as a
+// mutually exclusive choice.
+func DetectDefaultStore(lookup func(name string) (Helper, bool)) Helper {
+	names := os.Getenv("DOCKER_CREDENTIAL_HELPERS")
+	if names == "" {
+		names = defaultStoreNames
+	}
+	return chainFromNames(names, lookup)
+}
+
+func chainFromNames(names string, lookup func(name string) (Helper, bool)) *Chain {
+	var entries []Entry
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		readOnly := false
+		if strings.HasSuffix(name, ":ro") {
+			readOnly = true
+			name = strings.TrimSuffix(name, ":ro")
+		}
+
+		helper, ok := lookup(name)
+		if !ok {
+			continue
+		}
+
+		entries = append(entries, Entry{Name: name, Helper: helper, ReadOnly: readOnly})
+	}
+
+	return NewChain(entries...)
+}
+
+// Get tries each helper in order and returns the first hit. A helper
+// returning ErrCredentialsNotFound is skipped in favor of the next one; any
+// other error aborts the chain.
+func (c *Chain) Get(serverURL string) (string, string, error) {
+	for _, entry := range c.entries {
+		username, secret, err := entry.Helper.Get(serverURL)
+		if err == nil {
+			return username, secret, nil
+		}
+		if !IsErrCredentialsNotFound(err) {
+			return "", "", err
+		}
+	}
+
+	return "", "", NewErrCredentialsNotFound()
+}
+
+// Add writes the credentials to the first writable helper in the chain. If
+// every entry is read-only (or the chain is empty), it returns
+// ErrNoWritableHelper rather than ErrCredentialsNotFound: the latter means
+// "this backend doesn't have that key" and callers elsewhere in this file
+// use IsErrCredentialsNotFound to decide whether to keep falling back, which
+// isn't the right signal for "there's nowhere to write at all".
+func (c *Chain) Add(creds *Credentials) error {
+	for _, entry := range c.entries {
+		if entry.ReadOnly {
+			continue
+		}
+		return entry.Helper.Add(creds)
+	}
+
+	return NewErrNoWritableHelper()
+}
+
+// Delete removes the credentials from every helper in the chain that isn't
+// read-only, so a server URL can't linger in a lower-priority store.
+func (c *Chain) Delete(serverURL string) error {
+	for _, entry := range c.entries {
+		if entry.ReadOnly {
+			continue
+		}
+		if err := entry.Helper.Delete(serverURL); err != nil && !IsErrCredentialsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// List merges the entries of every helper in the chain, giving priority to
+// earlier helpers when the same server URL appears in more than one. Like
+// Get, a helper returning ErrCredentialsNotFound is skipped rather than
+// failing the whole chain, so one empty or unavailable backend doesn't take
+// down List for every other helper behind it.
+func (c *Chain) List() (map[string]string, error) {
+	merged := make(map[string]string)
+
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		accts, err := c.entries[i].Helper.List()
+		if err != nil {
+			if IsErrCredentialsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		for server, username := range accts {
+			merged[server] = username
+		}
+	}
+
+	return merged, nil
+}
+
+// GetAll merges the full credentials of every helper in the chain, giving
+// priority to earlier helpers when the same server URL appears in more than
+// one. Like Get, a helper returning ErrCredentialsNotFound is skipped rather
+// than failing the whole chain. A helper that doesn't implement AllGetter
+// falls back to GetAllFromListAndGet.
+func (c *Chain) GetAll() (map[string]Credentials, error) {
+	merged := make(map[string]Credentials)
+
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		all, err := getAll(c.entries[i].Helper)
+		if err != nil {
+			if IsErrCredentialsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		for server, creds := range all {
+			merged[server] = creds
+		}
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,186 @@
+package credentials
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// memHelper is a trivial in-memory Helper used to exercise Chain without any
+// platform-specific backend.
+type memHelper struct {
+	store map[string]Credentials
+	// failWith, if set, is returned by every method instead of touching store.
+	failWith error
+}
+
+func newMemHelper() *memHelper {
+	return &memHelper{store: make(map[string]Credentials)}
+}
+
+func (m *memHelper) Add(creds *Credentials) error {
+	if m.failWith != nil {
+		return m.failWith
+	}
+	m.store[creds.ServerURL] = *creds
+	return nil
+}
+
+func (m *memHelper) Delete(serverURL string) error {
+	if m.failWith != nil {
+		return m.failWith
+	}
+	delete(m.store, serverURL)
+	return nil
+}
+
+func (m *memHelper) Get(serverURL string) (string, string, error) {
+	if m.failWith != nil {
+		return "", "", m.failWith
+	}
+	creds, ok := m.store[serverURL]
+	if !ok {
+		return "", "", NewErrCredentialsNotFound()
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+func (m *memHelper) List() (map[string]string, error) {
+	if m.failWith != nil {
+		return nil, m.failWith
+	}
+	resp := make(map[string]string, len(m.store))
+	for server, creds := range m.store {
+		resp[server] = creds.Username
+	}
+	return resp, nil
+}
+
+func (m *memHelper) GetAll() (map[string]Credentials, error) {
+	if m.failWith != nil {
+		return nil, m.failWith
+	}
+	all := make(map[string]Credentials, len(m.store))
+	for server, creds := range m.store {
+		all[server] = creds
+	}
+	return all, nil
+}
+
+func TestChainGetFallsThroughNotFound(t *testing.T) {
+	first := newMemHelper()
+	second := newMemHelper()
+	second.store["example.com"] = Credentials{ServerURL: "example.com", Username: "bob", Secret: "s3cr3t"}
+
+	chain := NewChain(
+		Entry{Name: "first", Helper: first},
+		Entry{Name: "second", Helper: second},
+	)
+
+	username, secret, err := chain.Get("example.com")
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if username != "bob" || secret != "s3cr3t" {
+		t.Fatalf("Get returned (%q, %q), want (bob, s3cr3t)", username, secret)
+	}
+}
+
+func TestChainGetAbortsOnOtherError(t *testing.T) {
+	boom := errors.New("boom")
+	first := newMemHelper()
+	first.failWith = boom
+	second := newMemHelper()
+	second.store["example.com"] = Credentials{ServerURL: "example.com", Username: "bob", Secret: "s3cr3t"}
+
+	chain := NewChain(
+		Entry{Name: "first", Helper: first},
+		Entry{Name: "second", Helper: second},
+	)
+
+	if _, _, err := chain.Get("example.com"); err != boom {
+		t.Fatalf("Get returned %v, want %v", err, boom)
+	}
+}
+
+func TestChainListAndGetAllToleratesUnavailableHelper(t *testing.T) {
+	unavailable := newMemHelper()
+	unavailable.failWith = NewErrCredentialsNotFound()
+
+	working := newMemHelper()
+	working.store["example.com"] = Credentials{ServerURL: "example.com", Username: "bob", Secret: "s3cr3t"}
+
+	chain := NewChain(
+		Entry{Name: "unavailable", Helper: unavailable},
+		Entry{Name: "working", Helper: working},
+	)
+
+	accts, err := chain.List()
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if want := map[string]string{"example.com": "bob"}; !reflect.DeepEqual(accts, want) {
+		t.Fatalf("List returned %v, want %v", accts, want)
+	}
+
+	all, err := chain.GetAll()
+	if err != nil {
+		t.Fatalf("GetAll returned error: %v", err)
+	}
+	if len(all) != 1 || all["example.com"].Secret != "s3cr3t" {
+		t.Fatalf("GetAll returned %v, want one entry for example.com", all)
+	}
+}
+
+func TestChainListAndGetAllAbortOnOtherError(t *testing.T) {
+	boom := errors.New("boom")
+	broken := newMemHelper()
+	broken.failWith = boom
+
+	chain := NewChain(Entry{Name: "broken", Helper: broken})
+
+	if _, err := chain.List(); err != boom {
+		t.Fatalf("List returned %v, want %v", err, boom)
+	}
+	if _, err := chain.GetAll(); err != boom {
+		t.Fatalf("GetAll returned %v, want %v", err, boom)
+	}
+}
+
+func TestChainAddNoWritableEntry(t *testing.T) {
+	readOnly := newMemHelper()
+
+	chain := NewChain(Entry{Name: "readOnly", Helper: readOnly, ReadOnly: true})
+
+	err := chain.Add(&Credentials{ServerURL: "example.com", Username: "bob", Secret: "s3cr3t"})
+	if !IsErrNoWritableHelper(err) {
+		t.Fatalf("Add returned %v, want ErrNoWritableHelper", err)
+	}
+
+	empty := NewChain()
+	err = empty.Add(&Credentials{ServerURL: "example.com", Username: "bob", Secret: "s3cr3t"})
+	if !IsErrNoWritableHelper(err) {
+		t.Fatalf("Add on an empty chain returned %v, want ErrNoWritableHelper", err)
+	}
+}
+
+func TestChainAddSkipsReadOnly(t *testing.T) {
+	readOnly := newMemHelper()
+	writable := newMemHelper()
+
+	chain := NewChain(
+		Entry{Name: "readOnly", Helper: readOnly, ReadOnly: true},
+		Entry{Name: "writable", Helper: writable},
+	)
+
+	if err := chain.Add(&Credentials{ServerURL: "example.com", Username: "bob", Secret: "s3cr3t"}); err != nil {
+		t.Fatalf("Add returned error: %v", err)
+	}
+
+	if _, ok := readOnly.store["example.com"]; ok {
+		t.Fatal("Add wrote to a read-only entry")
+	}
+	if _, ok := writable.store["example.com"]; !ok {
+		t.Fatal("Add did not write to the writable entry")
+	}
+}
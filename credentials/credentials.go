@@ -0,0 +1,215 @@
+// Package credentials defines the structures and errors shared by the
+// docker-credential-helpers backends (osxkeychain, secretservice, wincred, pass, ...).
+package credentials
+
+import (
+	"errors"
+	"time"
+)
+
+// Credentials holds the information shared between docker and the credentials store.
+type Credentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+	// Profile optionally namespaces this entry so multiple identities can be
+	// stored against the same ServerURL, e.g. a "work" and a "personal" login
+	// for the same registry host.
+	Profile string
+	// IdentityToken is the long-lived OAuth refresh token returned by a
+	// registry's token auth flow, matching Docker's convention of storing it
+	// with Username == "<token>".
+	IdentityToken string
+	// AccessToken is the short-lived bearer token obtained by exchanging
+	// IdentityToken, kept separate so it can be refreshed on its own.
+	AccessToken string
+	// ExpiresAt is when AccessToken stops being valid. The zero value means
+	// no expiry is tracked.
+	ExpiresAt time.Time
+	// TokenType is the bearer token scheme, e.g. "Bearer".
+	TokenType string
+}
+
+// Token is the subset of Credentials a TokenHelper reads and writes, used so
+// callers can refresh AccessToken without touching IdentityToken or Secret.
+type Token struct {
+	IdentityToken string
+	AccessToken   string
+	ExpiresAt     time.Time
+	TokenType     string
+}
+
+// TokenHelper is implemented by stores that can persist OAuth identity/access
+// tokens alongside a Credentials entry and refresh the access token in place.
+type TokenHelper interface {
+	GetToken(serverURL string) (Token, error)
+	RefreshToken(serverURL string, newToken Token) error
+}
+
+// CredentialEntry is a single record returned by a profile-aware List, giving
+// back the profile that a plain map[string]string of server URL to username
+// would otherwise drop.
+type CredentialEntry struct {
+	ServerURL string
+	Username  string
+	Profile   string
+}
+
+// isValid checks the integrity of Credentials object such that no credentials lack
+// a server URL or a username.
+func (c *Credentials) isValid() (bool, error) {
+	if len(c.ServerURL) == 0 {
+		return false, NewErrCredentialsMissingServerURL()
+	}
+
+	if len(c.Username) == 0 {
+		return false, NewErrCredentialsMissingUsername()
+	}
+
+	return true, nil
+}
+
+// CredsLabel holds the way Docker credentials should be labeled as such in credentials
+// stores that allow labelling. That label allows to filter out non-Docker credentials
+// too at lookup/search in macOS keychain, Windows credentials manager and Linux
+// libsecret. Default value is "Docker Credentials"
+var CredsLabel = "Docker Credentials"
+
+// SetCredsLabel is a simple setter for CredsLabel
+func SetCredsLabel(label string) {
+	CredsLabel = label
+}
+
+// errCredentialsNotFound standardizes the not found error, so every helper returns
+// the same message and docker can handle it properly.
+var errCredentialsNotFound = errors.New("credentials not found in native keychain")
+
+// NewErrCredentialsNotFound creates a new error
+// for when the credentials are not in the store.
+func NewErrCredentialsNotFound() error {
+	return errCredentialsNotFound
+}
+
+// IsErrCredentialsNotFound returns true if the error
+// was caused by not having a set of credentials in a store.
+func IsErrCredentialsNotFound(err error) bool {
+	return err == errCredentialsNotFound
+}
+
+// errCredentialsMissingServerURL and errCredentialsMissingUsername standardize
+// invalid credentials or credentials operations
+var (
+	errCredentialsMissingServerURL = errors.New("no credentials server URL")
+	errCredentialsMissingUsername  = errors.New("no credentials username")
+)
+
+// NewErrCredentialsMissingServerURL creates a new error for errCredentialsMissingServerURL.
+func NewErrCredentialsMissingServerURL() error {
+	return errCredentialsMissingServerURL
+}
+
+// NewErrCredentialsMissingUsername creates a new error for errCredentialsMissingUsername.
+func NewErrCredentialsMissingUsername() error {
+	return errCredentialsMissingUsername
+}
+
+// IsCredentialsMissingServerURL returns true if the error
+// was caused by a missing server URL in credentials operations.
+func IsCredentialsMissingServerURL(err error) bool {
+	return err == errCredentialsMissingServerURL
+}
+
+// IsCredentialsMissingUsername returns true if the error
+// was caused by a missing username in credentials operations.
+func IsCredentialsMissingUsername(err error) bool {
+	return err == errCredentialsMissingUsername
+}
+
+// errUserAuthenticationRequired is returned by a store when access to a credential
+// is gated behind an interactive authentication prompt (e.g. Touch ID, a system
+// password, or an LAContext policy) and that prompt was declined or cancelled.
+var errUserAuthenticationRequired = errors.New("user authentication required to access credentials")
+
+// NewErrUserAuthenticationRequired creates a new error for errUserAuthenticationRequired.
+func NewErrUserAuthenticationRequired() error {
+	return errUserAuthenticationRequired
+}
+
+// IsErrUserAuthenticationRequired returns true if the error was caused by the user
+// declining or cancelling an authentication prompt required by the store.
+func IsErrUserAuthenticationRequired(err error) bool {
+	return err == errUserAuthenticationRequired
+}
+
+// errNoWritableHelper is returned by a composite Helper (e.g. Chain) when it
+// has no backend willing to accept a write, as distinct from
+// errCredentialsNotFound, which means a backend was asked about a specific
+// key and didn't have it.
+var errNoWritableHelper = errors.New("no writable credentials helper configured")
+
+// NewErrNoWritableHelper creates a new error for errNoWritableHelper.
+func NewErrNoWritableHelper() error {
+	return errNoWritableHelper
+}
+
+// IsErrNoWritableHelper returns true if the error was caused by a composite
+// Helper having no writable backend to satisfy an Add.
+func IsErrNoWritableHelper(err error) bool {
+	return err == errNoWritableHelper
+}
+
+// Helper is the interface a credentials store must implement.
+type Helper interface {
+	Add(*Credentials) error
+	Delete(serverURL string) error
+	Get(serverURL string) (string, string, error)
+	List() (map[string]string, error)
+}
+
+// AllGetter is implemented by stores that can fetch every credential in a
+// single native call (e.g. osxkeychain's single SecItemCopyMatching). It is
+// kept separate from Helper, rather than folded into it, so that adding it
+// doesn't break every existing Helper implementation: callers should type
+// assert a Helper to AllGetter and fall back to GetAllFromListAndGet when it
+// doesn't implement one.
+type AllGetter interface {
+	GetAll() (map[string]Credentials, error)
+}
+
+// getAll returns every credential in helper's store, using helper's native
+// GetAll when it implements AllGetter and falling back to
+// GetAllFromListAndGet otherwise. Shared by Chain.GetAll and the getall
+// Serve action.
+func getAll(helper Helper) (map[string]Credentials, error) {
+	if ag, ok := helper.(AllGetter); ok {
+		return ag.GetAll()
+	}
+	return GetAllFromListAndGet(helper)
+}
+
+// GetAllFromListAndGet is the fallback GetAll implementation for backends that
+// have no way to fetch every credential in a single native call: it lists the
+// store, then issues one Get per entry. Backends that can do better (e.g.
+// osxkeychain's single SecItemCopyMatching) should implement AllGetter
+// instead of relying on this.
+func GetAllFromListAndGet(helper Helper) (map[string]Credentials, error) {
+	accts, err := helper.List()
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(map[string]Credentials, len(accts))
+	for serverURL := range accts {
+		username, secret, err := helper.Get(serverURL)
+		if err != nil {
+			return nil, err
+		}
+		all[serverURL] = Credentials{
+			ServerURL: serverURL,
+			Username:  username,
+			Secret:    secret,
+		}
+	}
+
+	return all, nil
+}
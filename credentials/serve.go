@@ -0,0 +1,182 @@
+package credentials
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Action is a named subcommand that can be registered with Serve alongside
+// the built-in store/get/erase/list/getall actions. It lets extensions that
+// would otherwise import this package (and so can't be imported back by it,
+// such as the migrate package's export/import) hook into the same binary.
+type Action struct {
+	Name string
+	Run  func(helper Helper) error
+}
+
+// Serve initializes the credentials helper and parses the action argument.
+// This function is designed to be called from a command line interface of a
+// credential helper binary. It uses os.Args[1] as the action and os.Stdin as
+// the action's input, writing results to os.Stdout. extra registers
+// additional actions beyond the built-in ones.
+func Serve(helper Helper, extra ...Action) {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stdout, usage())
+		os.Exit(1)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "store":
+		err = Store(helper, os.Stdin)
+	case "get":
+		err = Get(helper, os.Stdin, os.Stdout)
+	case "erase":
+		err = Erase(helper, os.Stdin)
+	case "list":
+		err = List(helper, os.Stdin, os.Stdout)
+	case "getall":
+		err = GetAll(helper, os.Stdout)
+	case "version":
+		fmt.Fprintln(os.Stdout, usage())
+		return
+	default:
+		err = runExtra(helper, os.Args[1], extra)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runExtra(helper Helper, action string, extra []Action) error {
+	for _, a := range extra {
+		if a.Name == action {
+			return a.Run(helper)
+		}
+	}
+	return fmt.Errorf("unknown credential action `%s`", action)
+}
+
+func usage() string {
+	return fmt.Sprintf("Usage: %s <store|get|erase|list|getall>", os.Args[0])
+}
+
+func readLine(reader io.Reader) (string, error) {
+	scanner := bufio.NewScanner(reader)
+
+	buffer := new(strings.Builder)
+	for scanner.Scan() {
+		buffer.WriteString(scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// Store uses a helper and an input reader to save credentials. The reader
+// must contain the JSON serialization of a Credentials struct.
+func Store(helper Helper, reader io.Reader) error {
+	buffer, err := readLine(reader)
+	if err != nil {
+		return err
+	}
+
+	var creds Credentials
+	if err := json.NewDecoder(strings.NewReader(buffer)).Decode(&creds); err != nil {
+		return err
+	}
+
+	if ok, err := creds.isValid(); !ok {
+		return err
+	}
+
+	return helper.Add(&creds)
+}
+
+// Get retrieves the credentials for a given server url. The reader must
+// contain the server URL to search, the writer receives the JSON
+// serialization of the credentials.
+func Get(helper Helper, reader io.Reader, writer io.Writer) error {
+	serverURL, err := readLine(reader)
+	if err != nil {
+		return err
+	}
+	if serverURL == "" {
+		return NewErrCredentialsMissingServerURL()
+	}
+
+	username, secret, err := helper.Get(serverURL)
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(&Credentials{
+		ServerURL: serverURL,
+		Username:  username,
+		Secret:    secret,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(writer, string(buf))
+	return nil
+}
+
+// Erase removes credentials for a given server. The reader must contain the
+// server URL to remove.
+func Erase(helper Helper, reader io.Reader) error {
+	serverURL, err := readLine(reader)
+	if err != nil {
+		return err
+	}
+	if serverURL == "" {
+		return NewErrCredentialsMissingServerURL()
+	}
+
+	return helper.Delete(serverURL)
+}
+
+// List returns all the serverURLs and their associated usernames.
+func List(helper Helper, reader io.Reader, writer io.Writer) error {
+	accts, err := helper.List()
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(accts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(writer, string(buf))
+	return nil
+}
+
+// GetAll writes out the JSON serialization of every credential in the store
+// in a single round-trip, letting callers avoid one keychain prompt per
+// entry. It uses helper's native GetAll when helper implements AllGetter,
+// falling back to GetAllFromListAndGet otherwise.
+func GetAll(helper Helper, writer io.Writer) error {
+	all, err := getAll(helper)
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(writer, string(buf))
+	return nil
+}
@@ -0,0 +1,180 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// noAllGetterHelper wraps a memHelper but deliberately doesn't implement
+// AllGetter, so tests can exercise the GetAllFromListAndGet fallback path.
+type noAllGetterHelper struct {
+	inner *memHelper
+}
+
+func (n *noAllGetterHelper) Add(creds *Credentials) error         { return n.inner.Add(creds) }
+func (n *noAllGetterHelper) Delete(serverURL string) error        { return n.inner.Delete(serverURL) }
+func (n *noAllGetterHelper) Get(s string) (string, string, error) { return n.inner.Get(s) }
+func (n *noAllGetterHelper) List() (map[string]string, error)     { return n.inner.List() }
+
+func TestStore(t *testing.T) {
+	helper := newMemHelper()
+	input := `{"ServerURL":"example.com","Username":"bob","Secret":"s3cr3t"}`
+
+	if err := Store(helper, strings.NewReader(input)); err != nil {
+		t.Fatalf("Store returned error: %v", err)
+	}
+
+	creds, ok := helper.store["example.com"]
+	if !ok {
+		t.Fatal("Store did not write the entry")
+	}
+	if creds.Username != "bob" || creds.Secret != "s3cr3t" {
+		t.Fatalf("Store wrote %+v, want username bob / secret s3cr3t", creds)
+	}
+}
+
+func TestStoreRejectsInvalidCredentials(t *testing.T) {
+	helper := newMemHelper()
+	input := `{"ServerURL":"example.com"}`
+
+	err := Store(helper, strings.NewReader(input))
+	if !IsCredentialsMissingUsername(err) {
+		t.Fatalf("Store returned %v, want ErrCredentialsMissingUsername", err)
+	}
+}
+
+func TestGet(t *testing.T) {
+	helper := newMemHelper()
+	helper.store["example.com"] = Credentials{ServerURL: "example.com", Username: "bob", Secret: "s3cr3t"}
+
+	var out bytes.Buffer
+	if err := Get(helper, strings.NewReader("example.com"), &out); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(out.Bytes(), &creds); err != nil {
+		t.Fatalf("Get wrote invalid JSON: %v", err)
+	}
+	if creds.Username != "bob" || creds.Secret != "s3cr3t" {
+		t.Fatalf("Get wrote %+v, want username bob / secret s3cr3t", creds)
+	}
+}
+
+func TestGetMissingServerURL(t *testing.T) {
+	helper := newMemHelper()
+
+	var out bytes.Buffer
+	err := Get(helper, strings.NewReader(""), &out)
+	if !IsCredentialsMissingServerURL(err) {
+		t.Fatalf("Get returned %v, want ErrCredentialsMissingServerURL", err)
+	}
+}
+
+func TestErase(t *testing.T) {
+	helper := newMemHelper()
+	helper.store["example.com"] = Credentials{ServerURL: "example.com", Username: "bob", Secret: "s3cr3t"}
+
+	if err := Erase(helper, strings.NewReader("example.com")); err != nil {
+		t.Fatalf("Erase returned error: %v", err)
+	}
+	if _, ok := helper.store["example.com"]; ok {
+		t.Fatal("Erase did not remove the entry")
+	}
+}
+
+func TestList(t *testing.T) {
+	helper := newMemHelper()
+	helper.store["example.com"] = Credentials{ServerURL: "example.com", Username: "bob", Secret: "s3cr3t"}
+
+	var out bytes.Buffer
+	if err := List(helper, strings.NewReader(""), &out); err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+
+	var accts map[string]string
+	if err := json.Unmarshal(out.Bytes(), &accts); err != nil {
+		t.Fatalf("List wrote invalid JSON: %v", err)
+	}
+	if accts["example.com"] != "bob" {
+		t.Fatalf("List wrote %v, want example.com -> bob", accts)
+	}
+}
+
+func TestGetAllUsesNativeAllGetter(t *testing.T) {
+	helper := newMemHelper()
+	helper.store["example.com"] = Credentials{ServerURL: "example.com", Username: "bob", Secret: "s3cr3t"}
+
+	var out bytes.Buffer
+	if err := GetAll(helper, &out); err != nil {
+		t.Fatalf("GetAll returned error: %v", err)
+	}
+
+	var all map[string]Credentials
+	if err := json.Unmarshal(out.Bytes(), &all); err != nil {
+		t.Fatalf("GetAll wrote invalid JSON: %v", err)
+	}
+	if len(all) != 1 || all["example.com"].Secret != "s3cr3t" {
+		t.Fatalf("GetAll wrote %v, want one entry for example.com", all)
+	}
+}
+
+func TestGetAllFallsBackToListAndGet(t *testing.T) {
+	inner := newMemHelper()
+	inner.store["example.com"] = Credentials{ServerURL: "example.com", Username: "bob", Secret: "s3cr3t"}
+	helper := &noAllGetterHelper{inner: inner}
+
+	var out bytes.Buffer
+	if err := GetAll(helper, &out); err != nil {
+		t.Fatalf("GetAll returned error: %v", err)
+	}
+
+	var all map[string]Credentials
+	if err := json.Unmarshal(out.Bytes(), &all); err != nil {
+		t.Fatalf("GetAll wrote invalid JSON: %v", err)
+	}
+	if len(all) != 1 || all["example.com"].Secret != "s3cr3t" {
+		t.Fatalf("GetAll wrote %v, want one entry for example.com", all)
+	}
+}
+
+func TestRunExtraDispatchesRegisteredAction(t *testing.T) {
+	helper := newMemHelper()
+	var ran bool
+	extra := []Action{
+		{Name: "frob", Run: func(h Helper) error {
+			ran = true
+			if h != helper {
+				t.Fatal("runExtra called action with the wrong helper")
+			}
+			return nil
+		}},
+	}
+
+	if err := runExtra(helper, "frob", extra); err != nil {
+		t.Fatalf("runExtra returned error: %v", err)
+	}
+	if !ran {
+		t.Fatal("runExtra did not invoke the registered action")
+	}
+}
+
+func TestRunExtraPropagatesActionError(t *testing.T) {
+	boom := errors.New("boom")
+	extra := []Action{
+		{Name: "frob", Run: func(h Helper) error { return boom }},
+	}
+
+	if err := runExtra(newMemHelper(), "frob", extra); err != boom {
+		t.Fatalf("runExtra returned %v, want %v", err, boom)
+	}
+}
+
+func TestRunExtraUnknownAction(t *testing.T) {
+	if err := runExtra(newMemHelper(), "bogus", nil); err == nil {
+		t.Fatal("runExtra returned nil error for an unregistered action")
+	}
+}
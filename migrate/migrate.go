@@ -0,0 +1,207 @@
+// Package migrate provides an encrypted export/import format for moving a
+// credentials store's contents between machines, e.g. a keychain full of
+// registry logins onto a new laptop or into a CI secret store.
+package migrate
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// magic identifies a docker-credential-helpers migration export. It is
+// followed by a single version byte, so the format can evolve without
+// breaking older readers outright.
+const magic = "DOCKERCREDMIGR8\x00" // 16 bytes
+
+const version = byte(1)
+
+// scrypt parameters for deriving the XChaCha20-Poly1305 key from the
+// caller-supplied passphrase. N=32768/r=8/p=1 matches the scrypt "interactive"
+// work factor recommended for 2020s hardware.
+const (
+	scryptN  = 32768
+	scryptR  = 8
+	scryptP  = 1
+	saltSize = 16
+)
+
+// record is the JSON shape of a single migrated credential.
+type record struct {
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	Secret   string `json:"secret"`
+	Profile  string `json:"profile,omitempty"`
+}
+
+// getAll fetches every credential in helper, using its native GetAll when it
+// implements credentials.AllGetter and falling back to
+// credentials.GetAllFromListAndGet otherwise.
+func getAll(helper credentials.Helper) (map[string]credentials.Credentials, error) {
+	if ag, ok := helper.(credentials.AllGetter); ok {
+		return ag.GetAll()
+	}
+	return credentials.GetAllFromListAndGet(helper)
+}
+
+// Export writes every credential in helper to w as a versioned, passphrase
+// encrypted envelope: the magic + version, a random scrypt salt, a random
+// XChaCha20-Poly1305 nonce, then the sealed JSON array of records. It uses
+// GetAll so a keychain backend can serve the whole store in one call instead
+// of prompting once per entry.
+func Export(helper credentials.Helper, w io.Writer, passphrase []byte) error {
+	all, err := getAll(helper)
+	if err != nil {
+		return fmt.Errorf("migrate: listing credentials: %w", err)
+	}
+
+	records := make([]record, 0, len(all))
+	for server, creds := range all {
+		records = append(records, record{
+			Server:   server,
+			Username: creds.Username,
+			Secret:   creds.Secret,
+			Profile:  creds.Profile,
+		})
+	}
+
+	plaintext, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed := aead.Seal(nil, nonce, plaintext, nil)
+
+	for _, chunk := range [][]byte{[]byte(magic), {version}, salt, nonce, sealed} {
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Import reads an envelope written by Export from r and adds each record to
+// helper. A record that fails to Add does not abort the import; all failures
+// are collected and returned together once every record has been attempted.
+func Import(helper credentials.Helper, r io.Reader, passphrase []byte) error {
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("migrate: reading header: %w", err)
+	}
+	if string(header[:len(magic)]) != magic {
+		return fmt.Errorf("migrate: not a docker-credential-helpers export")
+	}
+	if header[len(magic)] != version {
+		return fmt.Errorf("migrate: unsupported export version %d", header[len(magic)])
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return fmt.Errorf("migrate: reading salt: %w", err)
+	}
+
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(r, nonce); err != nil {
+		return fmt.Errorf("migrate: reading nonce: %w", err)
+	}
+
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("migrate: reading ciphertext: %w", err)
+	}
+
+	plaintext, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return fmt.Errorf("migrate: wrong passphrase or corrupt export: %w", err)
+	}
+
+	var records []record
+	if err := json.Unmarshal(plaintext, &records); err != nil {
+		return err
+	}
+
+	var failures []string
+	for _, rec := range records {
+		err := helper.Add(&credentials.Credentials{
+			ServerURL: rec.Server,
+			Username:  rec.Username,
+			Secret:    rec.Secret,
+			Profile:   rec.Profile,
+		})
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", rec.Server, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("migrate: %d of %d entries failed to import:\n%s", len(failures), len(records), strings.Join(failures, "\n"))
+	}
+
+	return nil
+}
+
+func newAEAD(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: deriving key: %w", err)
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: initializing cipher: %w", err)
+	}
+
+	return aead, nil
+}
+
+// ExportAction adapts Export into a credentials.Action named "export" that
+// writes to os.Stdout, for registration with credentials.Serve.
+func ExportAction(passphrase []byte) credentials.Action {
+	return credentials.Action{
+		Name: "export",
+		Run: func(helper credentials.Helper) error {
+			return Export(helper, os.Stdout, passphrase)
+		},
+	}
+}
+
+// ImportAction adapts Import into a credentials.Action named "import" that
+// reads from os.Stdin, for registration with credentials.Serve.
+func ImportAction(passphrase []byte) credentials.Action {
+	return credentials.Action{
+		Name: "import",
+		Run: func(helper credentials.Helper) error {
+			return Import(helper, os.Stdin, passphrase)
+		},
+	}
+}
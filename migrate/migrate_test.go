@@ -0,0 +1,155 @@
+package migrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// memHelper is a trivial in-memory credentials.Helper used to exercise
+// Export/Import without any platform-specific backend.
+type memHelper struct {
+	store map[string]credentials.Credentials
+}
+
+func newMemHelper() *memHelper {
+	return &memHelper{store: make(map[string]credentials.Credentials)}
+}
+
+func (m *memHelper) Add(creds *credentials.Credentials) error {
+	m.store[creds.ServerURL] = *creds
+	return nil
+}
+
+func (m *memHelper) Delete(serverURL string) error {
+	delete(m.store, serverURL)
+	return nil
+}
+
+func (m *memHelper) Get(serverURL string) (string, string, error) {
+	creds, ok := m.store[serverURL]
+	if !ok {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+func (m *memHelper) List() (map[string]string, error) {
+	resp := make(map[string]string, len(m.store))
+	for server, creds := range m.store {
+		resp[server] = creds.Username
+	}
+	return resp, nil
+}
+
+func (m *memHelper) GetAll() (map[string]credentials.Credentials, error) {
+	all := make(map[string]credentials.Credentials, len(m.store))
+	for server, creds := range m.store {
+		all[server] = creds
+	}
+	return all, nil
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src := newMemHelper()
+	src.store["https://example.com"] = credentials.Credentials{
+		ServerURL: "https://example.com",
+		Username:  "bob",
+		Secret:    "s3cr3t",
+		Profile:   "work",
+	}
+	src.store["https://other.example.com"] = credentials.Credentials{
+		ServerURL: "https://other.example.com",
+		Username:  "alice",
+		Secret:    "hunter2",
+	}
+
+	passphrase := []byte("correct horse battery staple")
+
+	var buf bytes.Buffer
+	if err := Export(src, &buf, passphrase); err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+
+	dst := newMemHelper()
+	if err := Import(dst, &buf, passphrase); err != nil {
+		t.Fatalf("Import returned error: %v", err)
+	}
+
+	if len(dst.store) != len(src.store) {
+		t.Fatalf("Import produced %d entries, want %d", len(dst.store), len(src.store))
+	}
+	for server, want := range src.store {
+		got, ok := dst.store[server]
+		if !ok {
+			t.Fatalf("Import did not restore %q", server)
+		}
+		if got.Username != want.Username || got.Secret != want.Secret || got.Profile != want.Profile {
+			t.Fatalf("Import restored %q as %+v, want %+v", server, got, want)
+		}
+	}
+}
+
+func TestImportWrongPassphrase(t *testing.T) {
+	src := newMemHelper()
+	src.store["https://example.com"] = credentials.Credentials{
+		ServerURL: "https://example.com",
+		Username:  "bob",
+		Secret:    "s3cr3t",
+	}
+
+	var buf bytes.Buffer
+	if err := Export(src, &buf, []byte("right passphrase")); err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+
+	dst := newMemHelper()
+	err := Import(dst, &buf, []byte("wrong passphrase"))
+	if err == nil {
+		t.Fatal("Import with wrong passphrase returned no error")
+	}
+	if !strings.Contains(err.Error(), "wrong passphrase or corrupt export") {
+		t.Fatalf("Import returned %v, want a wrong passphrase/corrupt export error", err)
+	}
+}
+
+func TestImportCorruptEnvelope(t *testing.T) {
+	src := newMemHelper()
+	src.store["https://example.com"] = credentials.Credentials{
+		ServerURL: "https://example.com",
+		Username:  "bob",
+		Secret:    "s3cr3t",
+	}
+
+	passphrase := []byte("correct horse battery staple")
+
+	var buf bytes.Buffer
+	if err := Export(src, &buf, passphrase); err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+
+	corrupt := buf.Bytes()
+	corrupt[len(corrupt)-1] ^= 0xFF
+
+	dst := newMemHelper()
+	err := Import(dst, bytes.NewReader(corrupt), passphrase)
+	if err == nil {
+		t.Fatal("Import of a corrupt export returned no error")
+	}
+	if !strings.Contains(err.Error(), "wrong passphrase or corrupt export") {
+		t.Fatalf("Import returned %v, want a wrong passphrase/corrupt export error", err)
+	}
+}
+
+func TestImportRejectsBadMagic(t *testing.T) {
+	dst := newMemHelper()
+	err := Import(dst, strings.NewReader("not a real export at all, just junk"), []byte("whatever"))
+	if err == nil {
+		t.Fatal("Import of a non-export stream returned no error")
+	}
+	if !strings.Contains(err.Error(), "not a docker-credential-helpers export") {
+		t.Fatalf("Import returned %v, want a format error", err)
+	}
+}
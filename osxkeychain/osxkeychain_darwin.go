@@ -9,40 +9,169 @@ package osxkeychain
 */
 import "C"
 import (
+	"encoding/json"
 	"errors"
 	"net/url"
 	"regexp"
 	"strconv"
+	"time"
 	"unsafe"
 
 	"github.com/docker/docker-credential-helpers/credentials"
 )
 
+// tokenEnvelopeVersion is bumped whenever the shape of tokenEnvelope changes
+// in a way older binaries can't decode.
+const tokenEnvelopeVersion = 1
+
+// tokenEnvelope is the small JSON blob stashed in a keychain item's
+// kSecAttrGeneric attribute, carrying OAuth token metadata alongside the
+// existing username/secret fields. It also records the AddOptions the item
+// was last stored with, so a later RefreshToken (which has no AddOptions of
+// its own to go on) can replay them instead of silently re-adding the item
+// with no access control.
+type tokenEnvelope struct {
+	Version             int       `json:"version"`
+	IdentityToken       string    `json:"identity_token,omitempty"`
+	AccessToken         string    `json:"access_token,omitempty"`
+	ExpiresAt           time.Time `json:"expires_at,omitempty"`
+	TokenType           string    `json:"token_type,omitempty"`
+	RequireUserPresence bool      `json:"require_user_presence,omitempty"`
+	RequireBiometry     bool      `json:"require_biometry,omitempty"`
+	AccessGroup         string    `json:"access_group,omitempty"`
+}
+
+func (e tokenEnvelope) empty() bool {
+	return e.IdentityToken == "" && e.AccessToken == "" && e.TokenType == "" && e.ExpiresAt.IsZero()
+}
+
+// addOptions reconstructs the AddOptions this envelope's item was stored
+// with, so RefreshToken can preserve them when re-adding the item.
+func (e tokenEnvelope) addOptions() AddOptions {
+	return AddOptions{
+		RequireUserPresence: e.RequireUserPresence,
+		RequireBiometry:     e.RequireBiometry,
+		AccessGroup:         e.AccessGroup,
+	}
+}
+
+// hasAccessControl reports whether the envelope carries access-control
+// metadata worth persisting even when it has no token data of its own.
+func (e tokenEnvelope) hasAccessControl() bool {
+	return e.RequireUserPresence || e.RequireBiometry || e.AccessGroup != ""
+}
+
 // errCredentialsNotFound is the specific error message returned by OS X
 // when the credentials are not in the keychain.
 const errCredentialsNotFound = "The specified item could not be found in the keychain."
 
+// errUserAuthenticationRequired is the specific error message returned by the
+// keychain_get C shim when an item's access control policy (Touch ID, a
+// system password, ...) was declined or cancelled.
+const errUserAuthenticationRequired = "user authentication required"
+
 // Osxkeychain handles secrets using the OS X Keychain as store.
 type Osxkeychain struct{}
 
+// accessGroup is the signed keychain access group new items are tagged with,
+// letting a suite of tools built from the same team identifier share entries.
+// It is empty by default, meaning items are only visible to this process.
+var accessGroup string
+
+// SetAccessGroup sets the keychain access group that subsequent calls to Add
+// and AddWithOptions will tag new items with.
+func SetAccessGroup(group string) {
+	accessGroup = group
+}
+
+// AddOptions controls how a credential is protected once it is stored in the
+// keychain via AddWithOptions.
+type AddOptions struct {
+	// RequireUserPresence gates retrieval behind kSecAccessControlUserPresence
+	// (passcode, Touch ID or Apple Watch).
+	RequireUserPresence bool
+	// RequireBiometry gates retrieval behind kSecAccessControlBiometryCurrentSet,
+	// which additionally invalidates the item if the enrolled biometrics change.
+	RequireBiometry bool
+	// AccessGroup scopes the item to a signed keychain access group, overriding
+	// the group set via SetAccessGroup for this entry only.
+	AccessGroup string
+}
+
 // Add adds new credentials to the keychain.
 func (h Osxkeychain) Add(creds *credentials.Credentials) error {
-	h.Delete(creds.ServerURL)
+	return h.AddWithOptions(creds, AddOptions{})
+}
 
-	s, err := splitServer(creds.ServerURL)
+// AddWithOptions adds new credentials to the keychain, optionally requiring
+// user presence or biometric authentication before they can later be
+// retrieved with Get.
+func (h Osxkeychain) AddWithOptions(creds *credentials.Credentials, opts AddOptions) error {
+	s, profile, err := splitServer(creds.ServerURL)
 	if err != nil {
 		return err
 	}
 	defer freeServer(s)
 
+	if creds.Profile != "" {
+		profile = creds.Profile
+	}
+
+	// Clear out any existing entry for this exact profile before adding the
+	// new one. Must happen after profile is resolved to creds.Profile, or a
+	// caller setting Profile on the struct (rather than via the serverURL's
+	// ?profile= query param) would delete the wrong (unprofiled) item and
+	// leave the real target item in place to collide with the new SecItemAdd.
+	deleteProfile(s, profile)
+
 	label := C.CString(credentials.CredsLabel)
 	defer C.free(unsafe.Pointer(label))
 	username := C.CString(creds.Username)
 	defer C.free(unsafe.Pointer(username))
 	secret := C.CString(creds.Secret)
 	defer C.free(unsafe.Pointer(secret))
+	profileC := C.CString(profile)
+	defer C.free(unsafe.Pointer(profileC))
+
+	group := opts.AccessGroup
+	if group == "" {
+		group = accessGroup
+	}
+
+	envelope := tokenEnvelope{
+		Version:             tokenEnvelopeVersion,
+		IdentityToken:       creds.IdentityToken,
+		AccessToken:         creds.AccessToken,
+		ExpiresAt:           creds.ExpiresAt,
+		TokenType:           creds.TokenType,
+		RequireUserPresence: opts.RequireUserPresence,
+		RequireBiometry:     opts.RequireBiometry,
+		AccessGroup:         group,
+	}
+	var genericC *C.char
+	if !envelope.empty() || envelope.hasAccessControl() {
+		buf, err := json.Marshal(envelope)
+		if err != nil {
+			return err
+		}
+		genericC = C.CString(string(buf))
+		defer C.free(unsafe.Pointer(genericC))
+	}
+
+	var acOpts C.struct_AccessControlOptions
+	if opts.RequireUserPresence {
+		acOpts.requireUserPresence = 1
+	}
+	if opts.RequireBiometry {
+		acOpts.requireBiometryCurrentSet = 1
+	}
+	if group != "" {
+		groupC := C.CString(group)
+		defer C.free(unsafe.Pointer(groupC))
+		acOpts.accessGroup = groupC
+	}
 
-	errMsg := C.keychain_add(s, label, username, secret)
+	errMsg := C.keychain_add_with_access_control(s, label, username, secret, profileC, genericC, &acOpts)
 	if errMsg != nil {
 		defer C.free(unsafe.Pointer(errMsg))
 		return errors.New(C.GoString(errMsg))
@@ -51,15 +180,26 @@ func (h Osxkeychain) Add(creds *credentials.Credentials) error {
 	return nil
 }
 
-// Delete removes credentials from the keychain.
+// Delete removes credentials from the keychain. serverURL may carry a
+// `?profile=` query parameter to remove only that profile's entry.
 func (h Osxkeychain) Delete(serverURL string) error {
-	s, err := splitServer(serverURL)
+	s, profile, err := splitServer(serverURL)
 	if err != nil {
 		return err
 	}
 	defer freeServer(s)
 
-	errMsg := C.keychain_delete(s)
+	return deleteProfile(s, profile)
+}
+
+// deleteProfile removes the keychain item for s scoped to profile (the empty
+// string meaning the unprofiled item). It is shared by Delete and the
+// pre-add cleanup in AddWithOptions so both agree on which profile to target.
+func deleteProfile(s *C.struct_Server, profile string) error {
+	profileC := C.CString(profile)
+	defer C.free(unsafe.Pointer(profileC))
+
+	errMsg := C.keychain_delete(s, profileC)
 	if errMsg != nil {
 		defer C.free(unsafe.Pointer(errMsg))
 		return errors.New(C.GoString(errMsg))
@@ -69,38 +209,169 @@ func (h Osxkeychain) Delete(serverURL string) error {
 }
 
 // Get returns the username and secret to use for a given registry server URL.
+// serverURL may carry a `?profile=work` query parameter to select among
+// multiple identities stored against the same host.
 func (h Osxkeychain) Get(serverURL string) (string, string, error) {
-	s, err := splitServer(serverURL)
+	username, secret, _, err := h.getEntry(serverURL)
 	if err != nil {
 		return "", "", err
 	}
+	return username, secret, nil
+}
+
+// GetToken returns the OAuth token metadata stored alongside the credentials
+// for a given registry server URL, satisfying credentials.TokenHelper.
+func (h Osxkeychain) GetToken(serverURL string) (credentials.Token, error) {
+	_, _, envelope, err := h.getEntry(serverURL)
+	if err != nil {
+		return credentials.Token{}, err
+	}
+
+	if envelope.empty() {
+		return credentials.Token{}, credentials.NewErrCredentialsNotFound()
+	}
+
+	return credentials.Token{
+		IdentityToken: envelope.IdentityToken,
+		AccessToken:   envelope.AccessToken,
+		ExpiresAt:     envelope.ExpiresAt,
+		TokenType:     envelope.TokenType,
+	}, nil
+}
+
+// getEntry fetches the username, secret and token envelope stored for
+// serverURL with a single keychain_get call, so Get, GetToken and
+// RefreshToken don't each trigger their own access-control prompt for the
+// same access-control-gated item.
+func (h Osxkeychain) getEntry(serverURL string) (username, secret string, envelope tokenEnvelope, err error) {
+	s, profile, err := splitServer(serverURL)
+	if err != nil {
+		return "", "", tokenEnvelope{}, err
+	}
 	defer freeServer(s)
 
+	profileC := C.CString(profile)
+	defer C.free(unsafe.Pointer(profileC))
+
 	var usernameLen C.uint
-	var username *C.char
+	var usernameC *C.char
 	var secretLen C.uint
-	var secret *C.char
-	defer C.free(unsafe.Pointer(username))
-	defer C.free(unsafe.Pointer(secret))
+	var secretC *C.char
+	var genericLen C.uint
+	var genericC *C.char
+	defer C.free(unsafe.Pointer(usernameC))
+	defer C.free(unsafe.Pointer(secretC))
+	defer C.free(unsafe.Pointer(genericC))
 
-	errMsg := C.keychain_get(s, &usernameLen, &username, &secretLen, &secret)
+	errMsg := C.keychain_get(s, profileC, &usernameLen, &usernameC, &secretLen, &secretC, &genericLen, &genericC)
 	if errMsg != nil {
 		defer C.free(unsafe.Pointer(errMsg))
 		goMsg := C.GoString(errMsg)
 		if goMsg == errCredentialsNotFound {
-			return "", "", credentials.NewErrCredentialsNotFound()
+			return "", "", tokenEnvelope{}, credentials.NewErrCredentialsNotFound()
 		}
+		if goMsg == errUserAuthenticationRequired {
+			return "", "", tokenEnvelope{}, credentials.NewErrUserAuthenticationRequired()
+		}
+
+		return "", "", tokenEnvelope{}, errors.New(goMsg)
+	}
+
+	username = C.GoStringN(usernameC, C.int(usernameLen))
+	secret = C.GoStringN(secretC, C.int(secretLen))
+
+	if genericLen > 0 {
+		envelope, err = decodeTokenEnvelope(genericC, genericLen)
+		if err != nil {
+			return "", "", tokenEnvelope{}, err
+		}
+	}
+
+	// Docker's registry auth flow convention is to store the identity token
+	// in the secret slot when the username is the literal "<token>".
+	if username == "<token>" && envelope.IdentityToken != "" {
+		secret = envelope.IdentityToken
+	}
+
+	return username, secret, envelope, nil
+}
 
-		return "", "", errors.New(goMsg)
+// RefreshToken updates the access token for an existing entry, keeping its
+// secret, and its identity token unless newToken carries a non-empty one,
+// satisfying credentials.TokenHelper.
+// The entry is re-added with the AddOptions recorded in its token envelope
+// at the last Add/AddWithOptions call, so an item stored with
+// RequireUserPresence, RequireBiometry or a custom AccessGroup keeps those
+// in place across the refresh instead of being silently downgraded to an
+// unprotected item. Use RefreshTokenWithOptions to set different options.
+func (h Osxkeychain) RefreshToken(serverURL string, newToken credentials.Token) error {
+	username, secret, existing, err := h.getEntry(serverURL)
+	if err != nil {
+		return err
 	}
 
-	user := C.GoStringN(username, C.int(usernameLen))
-	pass := C.GoStringN(secret, C.int(secretLen))
-	return user, pass, nil
+	return h.refreshToken(serverURL, newToken, existing.addOptions(), username, secret, existing)
+}
+
+// RefreshTokenWithOptions is RefreshToken, but re-adds the entry with opts
+// in place of the AddOptions recorded in its token envelope.
+func (h Osxkeychain) RefreshTokenWithOptions(serverURL string, newToken credentials.Token, opts AddOptions) error {
+	username, secret, existing, err := h.getEntry(serverURL)
+	if err != nil {
+		return err
+	}
+
+	return h.refreshToken(serverURL, newToken, opts, username, secret, existing)
+}
+
+// refreshToken is the shared tail of RefreshToken and RefreshTokenWithOptions,
+// taking the result of an already-performed getEntry so the two don't issue
+// a second keychain_get (and a second access-control prompt) against each
+// other.
+func (h Osxkeychain) refreshToken(serverURL string, newToken credentials.Token, opts AddOptions, username, secret string, existing tokenEnvelope) error {
+	identityToken := newToken.IdentityToken
+	if identityToken == "" {
+		identityToken = existing.IdentityToken
+	}
+
+	return h.AddWithOptions(&credentials.Credentials{
+		ServerURL:     serverURL,
+		Username:      username,
+		Secret:        secret,
+		IdentityToken: identityToken,
+		AccessToken:   newToken.AccessToken,
+		ExpiresAt:     newToken.ExpiresAt,
+		TokenType:     newToken.TokenType,
+	}, opts)
+}
+
+func decodeTokenEnvelope(generic *C.char, genericLen C.uint) (tokenEnvelope, error) {
+	var envelope tokenEnvelope
+	raw := C.GoBytes(unsafe.Pointer(generic), C.int(genericLen))
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return tokenEnvelope{}, err
+	}
+	return envelope, nil
 }
 
-// List returns the stored URLs and corresponding usernames.
+// List returns the stored URLs and corresponding usernames, with the shim
+// API: profile information is dropped. Use ListWithProfiles to get it back.
 func (h Osxkeychain) List() (map[string]string, error) {
+	entries, err := h.ListWithProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make(map[string]string, len(entries))
+	for server, entry := range entries {
+		resp[server] = entry.Username
+	}
+	return resp, nil
+}
+
+// ListWithProfiles returns the stored URLs, usernames and profiles. Entries
+// added without a profile come back with an empty Profile field.
+func (h Osxkeychain) ListWithProfiles() (map[string]credentials.CredentialEntry, error) {
 	credsLabelC := C.CString(credentials.CredsLabel)
 	defer C.free(unsafe.Pointer(credsLabelC))
 
@@ -108,8 +379,10 @@ func (h Osxkeychain) List() (map[string]string, error) {
 	defer C.free(unsafe.Pointer(pathsC))
 	var acctsC **C.char
 	defer C.free(unsafe.Pointer(acctsC))
+	var profilesC **C.char
+	defer C.free(unsafe.Pointer(profilesC))
 	var listLenC C.uint
-	errMsg := C.keychain_list(credsLabelC, &pathsC, &acctsC, &listLenC)
+	errMsg := C.keychain_list(credsLabelC, &pathsC, &acctsC, &profilesC, &listLenC)
 	if errMsg != nil {
 		defer C.free(unsafe.Pointer(errMsg))
 		goMsg := C.GoString(errMsg)
@@ -118,26 +391,111 @@ func (h Osxkeychain) List() (map[string]string, error) {
 
 	defer C.freeListData(&pathsC, listLenC)
 	defer C.freeListData(&acctsC, listLenC)
+	defer C.freeListData(&profilesC, listLenC)
 
 	var listLen int
 	listLen = int(listLenC)
 	pathTmp := (*[1 << 30]*C.char)(unsafe.Pointer(pathsC))[:listLen:listLen]
 	acctTmp := (*[1 << 30]*C.char)(unsafe.Pointer(acctsC))[:listLen:listLen]
+	profileTmp := (*[1 << 30]*C.char)(unsafe.Pointer(profilesC))[:listLen:listLen]
 	//taking the array of c strings into go while ignoring all the stuff irrelevant to credentials-helper
-	resp := make(map[string]string)
+	resp := make(map[string]credentials.CredentialEntry)
 	for i := 0; i < listLen; i++ {
-		if C.GoString(pathTmp[i]) == "0" {
+		server := C.GoString(pathTmp[i])
+		if server == "0" {
 			continue
 		}
-		resp[C.GoString(pathTmp[i])] = C.GoString(acctTmp[i])
+		resp[server] = credentials.CredentialEntry{
+			ServerURL: server,
+			Username:  C.GoString(acctTmp[i]),
+			Profile:   C.GoString(profileTmp[i]),
+		}
 	}
 	return resp, nil
 }
 
+// GetAll returns every stored credential in a single SecItemCopyMatching call,
+// avoiding the per-entry keychain ACL prompt that calling Get once per List
+// entry would trigger.
+func (h Osxkeychain) GetAll() (map[string]credentials.Credentials, error) {
+	credsLabelC := C.CString(credentials.CredsLabel)
+	defer C.free(unsafe.Pointer(credsLabelC))
+
+	var pathsC, acctsC, secretsC, profilesC, genericsC **C.char
+	var secretLensC, genericLensC *C.uint
+	defer C.free(unsafe.Pointer(pathsC))
+	defer C.free(unsafe.Pointer(acctsC))
+	defer C.free(unsafe.Pointer(secretsC))
+	defer C.free(unsafe.Pointer(secretLensC))
+	defer C.free(unsafe.Pointer(profilesC))
+	defer C.free(unsafe.Pointer(genericsC))
+	defer C.free(unsafe.Pointer(genericLensC))
+	var listLenC C.uint
+
+	errMsg := C.keychain_get_all(credsLabelC, &pathsC, &acctsC, &secretsC, &secretLensC, &profilesC, &genericsC, &genericLensC, &listLenC)
+	if errMsg != nil {
+		defer C.free(unsafe.Pointer(errMsg))
+		goMsg := C.GoString(errMsg)
+		if goMsg == errUserAuthenticationRequired {
+			return nil, credentials.NewErrUserAuthenticationRequired()
+		}
+		return nil, errors.New(goMsg)
+	}
+
+	defer C.freeListData(&pathsC, listLenC)
+	defer C.freeListData(&acctsC, listLenC)
+	defer C.freeListData(&secretsC, listLenC)
+	defer C.freeListData(&profilesC, listLenC)
+	defer C.freeListData(&genericsC, listLenC)
+
+	listLen := int(listLenC)
+	pathTmp := (*[1 << 30]*C.char)(unsafe.Pointer(pathsC))[:listLen:listLen]
+	acctTmp := (*[1 << 30]*C.char)(unsafe.Pointer(acctsC))[:listLen:listLen]
+	secretTmp := (*[1 << 30]*C.char)(unsafe.Pointer(secretsC))[:listLen:listLen]
+	secretLenTmp := (*[1 << 30]C.uint)(unsafe.Pointer(secretLensC))[:listLen:listLen]
+	profileTmp := (*[1 << 30]*C.char)(unsafe.Pointer(profilesC))[:listLen:listLen]
+	genericTmp := (*[1 << 30]*C.char)(unsafe.Pointer(genericsC))[:listLen:listLen]
+	genericLenTmp := (*[1 << 30]C.uint)(unsafe.Pointer(genericLensC))[:listLen:listLen]
+
+	all := make(map[string]credentials.Credentials)
+	for i := 0; i < listLen; i++ {
+		server := C.GoString(pathTmp[i])
+		if server == "0" {
+			continue
+		}
+
+		creds := credentials.Credentials{
+			ServerURL: server,
+			Username:  C.GoString(acctTmp[i]),
+			Secret:    C.GoStringN(secretTmp[i], C.int(secretLenTmp[i])),
+			Profile:   C.GoString(profileTmp[i]),
+		}
+
+		if genericLen := genericLenTmp[i]; genericLen > 0 {
+			var envelope tokenEnvelope
+			raw := C.GoBytes(unsafe.Pointer(genericTmp[i]), C.int(genericLen))
+			if err := json.Unmarshal(raw, &envelope); err == nil {
+				creds.IdentityToken = envelope.IdentityToken
+				creds.AccessToken = envelope.AccessToken
+				creds.ExpiresAt = envelope.ExpiresAt
+				creds.TokenType = envelope.TokenType
+				if creds.Username == "<token>" && envelope.IdentityToken != "" {
+					creds.Secret = envelope.IdentityToken
+				}
+			}
+		}
+
+		all[server] = creds
+	}
+
+	return all, nil
+}
+
 // splitServer() creates a proper server structure for OSX Keychain API
 // It normalizes if needed the format of the URL. Of no protocol is
-// provided, HTTPS will be used by default.
-func splitServer(serverURL string) (*C.struct_Server, error) {
+// provided, HTTPS will be used by default. A `profile` query parameter, if
+// present, is stripped out and returned separately.
+func splitServer(serverURL string) (*C.struct_Server, string, error) {
 	// Check if we have a scheme in the URL as of RFC 3986, section 3.1
 	// and prepend '//' to normalize to a valid URL format
 	if !regexp.MustCompile(`^([a-zA-Z][-+.a-zA-Z0-9]+:)?//`).MatchString(serverURL) {
@@ -146,16 +504,16 @@ func splitServer(serverURL string) (*C.struct_Server, error) {
 
 	u, err := url.Parse(serverURL)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	// We only support HTTPS and HTTP for registries
 	if u.Scheme != "" && u.Scheme != "https" && u.Scheme != "http" {
-		return nil, errors.New("unsupported scheme: " + u.Scheme)
+		return nil, "", errors.New("unsupported scheme: " + u.Scheme)
 	}
 
 	if u.Hostname() == "" {
-		return nil, errors.New("no hostname in URL")
+		return nil, "", errors.New("no hostname in URL")
 	}
 
 	// If no protocol is specified, we use HTTPS
@@ -168,16 +526,18 @@ func splitServer(serverURL string) (*C.struct_Server, error) {
 	if u.Port() != "" {
 		port, err = strconv.Atoi(u.Port())
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	}
 
+	profile := u.Query().Get("profile")
+
 	return &C.struct_Server{
 		proto: C.SecProtocolType(proto),
 		host:  C.CString(u.Host),
 		port:  C.uint(port),
 		path:  C.CString(u.Path),
-	}, nil
+	}, profile, nil
 }
 
 func freeServer(s *C.struct_Server) {